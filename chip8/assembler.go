@@ -0,0 +1,842 @@
+/* Copyright (c) 2017 Jeffrey Massung
+ *
+ * This software is provided 'as-is', without any express or implied
+ * warranty.  In no event will the authors be held liable for any damages
+ * arising from the use of this software.
+ *
+ * Permission is granted to anyone to use this software for any purpose,
+ * including commercial applications, and to alter it and redistribute it
+ * freely, subject to the following restrictions:
+ *
+ * 1. The origin of this software must not be misrepresented; you must not
+ *    claim that you wrote the original software. If you use this software
+ *    in a product, an acknowledgment in the product documentation would be
+ *    appreciated but is not required.
+ *
+ * 2. Altered source versions must be plainly marked as such, and must not be
+ *    misrepresented as being the original software.
+ *
+ * 3. This notice may not be removed or altered from any source distribution.
+ */
+
+package chip8
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+/// Assembly is the machine code produced by Assemble, ready for LoadAssembly.
+///
+type Assembly struct {
+	Code []byte
+}
+
+/// VAR allocates scratch variables from a small pool in high memory, clear
+/// of program code and the interpreter font.
+///
+const varPoolStart = 0xEA0
+const varPoolEnd = 0xF00
+
+/// Assemble reads and assembles a CHIP-8 assembly source file.
+///
+/// Syntax is line-oriented: a label is an identifier with no leading
+/// whitespace on its own line; everything else is indented. Instructions
+/// and pseudo-ops (ASCII, BYTE, WORD, ALIGN, PAD, EQU, VAR, ASSERT, BREAK)
+/// take comma-separated operands, same as the operands of a real opcode.
+/// On error the returned Assembly is empty, never nil.
+///
+func Assemble(path string) (*Assembly, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return &Assembly{}, err
+	}
+
+	return assembleSource(data)
+}
+
+func assembleSource(data []byte) (asm *Assembly, err error) {
+	lines := splitLines(data)
+
+	labels := map[string]int{}
+	consts := map[string]int{}
+
+	if err = layout(lines, labels, consts); err != nil {
+		return &Assembly{}, err
+	}
+
+	code, err := emit(lines, labels, consts)
+	if err != nil {
+		return &Assembly{}, err
+	}
+
+	return &Assembly{Code: code}, nil
+}
+
+func splitLines(data []byte) []string {
+	var lines []string
+	start := 0
+
+	for i, b := range data {
+		if b == '\n' {
+			lines = append(lines, string(data[start:i]))
+			start = i + 1
+		}
+	}
+
+	if start < len(data) {
+		lines = append(lines, string(data[start:]))
+	}
+
+	return lines
+}
+
+/// layout is the first assembler pass: it walks every line just far enough
+/// to know how many bytes each one will emit, recording label, EQU, and VAR
+/// addresses along the way so forward references resolve in emit.
+///
+func layout(lines []string, labels, consts map[string]int) error {
+	addr := ProgramStart
+	varAddr := varPoolStart
+
+	for n, line := range lines {
+		err := withRecover(func() error {
+			s := &tokenScanner{bytes: []byte(line)}
+
+			t := s.scanToken()
+			if t.typ == TOKEN_END {
+				return nil
+			}
+
+			if t.typ == TOKEN_LABEL {
+				labels[t.val.(string)] = addr
+
+				if t = s.scanToken(); t.typ == TOKEN_END {
+					return nil
+				}
+			}
+
+			switch t.typ {
+			case TOKEN_VAR:
+				operands := s.scanOperands()
+				if len(operands) != 1 || operands[0].typ != TOKEN_ID {
+					return fmt.Errorf("VAR requires a single name")
+				}
+
+				if varAddr >= varPoolEnd {
+					return fmt.Errorf("VAR pool exhausted")
+				}
+
+				labels[operands[0].val.(string)] = varAddr
+				varAddr += 2
+			case TOKEN_EQU:
+				operands := s.scanOperands()
+				if len(operands) != 2 || operands[0].typ != TOKEN_ID {
+					return fmt.Errorf("EQU requires a name and a literal value")
+				}
+
+				v, ok := literalValue(operands[1])
+				if !ok {
+					return fmt.Errorf("EQU value must be a literal")
+				}
+
+				consts[operands[0].val.(string)] = v
+			case TOKEN_ASSERT:
+				s.scanOperands()
+			case TOKEN_BREAK:
+				addr += 2
+			case TOKEN_INSTRUCTION:
+				operands := s.scanOperands()
+
+				size, err := instructionSize(t.val.(string), operands, addr)
+				if err != nil {
+					return err
+				}
+
+				addr += size
+			default:
+				return fmt.Errorf("unexpected token")
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n+1, err)
+		}
+	}
+
+	return nil
+}
+
+/// emit is the second assembler pass: with every label resolved, it encodes
+/// the actual instruction bytes.
+///
+func emit(lines []string, labels, consts map[string]int) ([]byte, error) {
+	code := make([]byte, 0, 256)
+	pc := ProgramStart
+
+	for n, line := range lines {
+		err := withRecover(func() error {
+			s := &tokenScanner{bytes: []byte(line)}
+
+			t := s.scanToken()
+			if t.typ == TOKEN_END {
+				return nil
+			}
+
+			if t.typ == TOKEN_LABEL {
+				if t = s.scanToken(); t.typ == TOKEN_END {
+					return nil
+				}
+			}
+
+			switch t.typ {
+			case TOKEN_VAR:
+				s.scanOperands()
+			case TOKEN_EQU:
+				s.scanOperands()
+			case TOKEN_ASSERT:
+				operands := s.scanOperands()
+				if len(operands) != 2 {
+					return fmt.Errorf("ASSERT requires two operands")
+				}
+
+				a, err := resolveValue(operands[0], labels, consts, pc)
+				if err != nil {
+					return err
+				}
+
+				b, err := resolveValue(operands[1], labels, consts, pc)
+				if err != nil {
+					return err
+				}
+
+				if a != b {
+					return fmt.Errorf("assertion failed: %d != %d", a, b)
+				}
+			case TOKEN_BREAK:
+				code = append(code, 0x00, 0x01)
+				pc += 2
+			case TOKEN_INSTRUCTION:
+				operands := s.scanOperands()
+
+				bs, err := encode(t.val.(string), operands, labels, consts, pc)
+				if err != nil {
+					return err
+				}
+
+				code = append(code, bs...)
+				pc += len(bs)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+	}
+
+	return code, nil
+}
+
+/// withRecover converts a scanner panic (its convention for a syntax error)
+/// into a regular error.
+///
+func withRecover(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	return fn()
+}
+
+func literalValue(t token) (int, bool) {
+	if t.typ == TOKEN_LIT {
+		return t.val.(int), true
+	}
+
+	return 0, false
+}
+
+func resolveValue(t token, labels, consts map[string]int, pc int) (int, error) {
+	switch t.typ {
+	case TOKEN_LIT:
+		return t.val.(int), nil
+	case TOKEN_HERE:
+		return pc, nil
+	case TOKEN_ID:
+		name := t.val.(string)
+
+		if v, ok := labels[name]; ok {
+			return v, nil
+		}
+
+		if v, ok := consts[name]; ok {
+			return v, nil
+		}
+
+		return 0, fmt.Errorf("undefined symbol: %q", name)
+	}
+
+	return 0, fmt.Errorf("expected a value")
+}
+
+/// instructionSize returns the number of bytes mnemonic will assemble to at
+/// addr, given operands, without needing any symbol to be resolved yet.
+///
+func instructionSize(mnemonic string, operands []token, addr int) (int, error) {
+	switch mnemonic {
+	case "LDL":
+		return 4, nil
+	case "BYTE":
+		return 1, nil
+	case "WORD":
+		return 2, nil
+	case "ASCII":
+		if len(operands) != 1 || operands[0].typ != TOKEN_TEXT {
+			return 0, fmt.Errorf("ASCII requires a single string operand")
+		}
+
+		return len(operands[0].val.(string)), nil
+	case "ALIGN":
+		if len(operands) != 1 {
+			return 0, fmt.Errorf("ALIGN requires a single literal operand")
+		}
+
+		boundary, ok := literalValue(operands[0])
+		if !ok || boundary <= 0 {
+			return 0, fmt.Errorf("ALIGN requires a positive literal operand")
+		}
+
+		return (boundary - addr%boundary) % boundary, nil
+	case "PAD":
+		if len(operands) != 1 {
+			return 0, fmt.Errorf("PAD requires a single literal operand")
+		}
+
+		n, ok := literalValue(operands[0])
+		if !ok || n < 0 {
+			return 0, fmt.Errorf("PAD requires a non-negative literal operand")
+		}
+
+		return n, nil
+	}
+
+	return 2, nil
+}
+
+/// encode assembles a single mnemonic plus its operands into machine code,
+/// resolving any label/const references against labels/consts.
+///
+func encode(mnemonic string, operands []token, labels, consts map[string]int, pc int) ([]byte, error) {
+	resolve := func(t token) (int, error) {
+		return resolveValue(t, labels, consts, pc)
+	}
+
+	word := func(op uint) []byte {
+		return []byte{byte(op >> 8), byte(op)}
+	}
+
+	vReg := func(t token) (uint, bool) {
+		if t.typ != TOKEN_V {
+			return 0, false
+		}
+
+		return uint(t.val.(int)), true
+	}
+
+	vOnly := func() (uint, bool) {
+		if len(operands) != 1 {
+			return 0, false
+		}
+
+		return vReg(operands[0])
+	}
+
+	vv := func(base uint) ([]byte, error) {
+		if len(operands) != 2 {
+			return nil, fmt.Errorf("%s requires two V registers", mnemonic)
+		}
+
+		x, xok := vReg(operands[0])
+		y, yok := vReg(operands[1])
+
+		if !xok || !yok {
+			return nil, fmt.Errorf("%s requires two V registers", mnemonic)
+		}
+
+		return word(base | x<<8 | y<<4), nil
+	}
+
+	switch mnemonic {
+	case "CLS":
+		return word(0x00E0), nil
+	case "RET":
+		return word(0x00EE), nil
+	case "LOW":
+		return word(0x00FE), nil
+	case "HIGH":
+		return word(0x00FF), nil
+	case "SCR":
+		return word(0x00FB), nil
+	case "SCL":
+		return word(0x00FC), nil
+	case "EXIT":
+		return word(0x00FD), nil
+	case "SYS":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("SYS requires one address operand")
+		}
+
+		a, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(uint(a) & 0xFFF), nil
+	case "SCU":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("SCU requires one literal operand")
+		}
+
+		n, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(0x00B0 | uint(n)&0xF), nil
+	case "SCD":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("SCD requires one literal operand")
+		}
+
+		n, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(0x00C0 | uint(n)&0xF), nil
+	case "JP":
+		switch len(operands) {
+		case 1:
+			a, err := resolve(operands[0])
+			if err != nil {
+				return nil, err
+			}
+
+			return word(0x1000 | uint(a)&0xFFF), nil
+		case 2:
+			if x, ok := vReg(operands[0]); !ok || x != 0 {
+				return nil, fmt.Errorf("JP with two operands requires V0")
+			}
+
+			a, err := resolve(operands[1])
+			if err != nil {
+				return nil, err
+			}
+
+			return word(0xB000 | uint(a)&0xFFF), nil
+		}
+
+		return nil, fmt.Errorf("JP requires one or two operands")
+	case "CALL":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("CALL requires one address operand")
+		}
+
+		a, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(0x2000 | uint(a)&0xFFF), nil
+	case "SE", "SNE":
+		if len(operands) != 2 {
+			return nil, fmt.Errorf("%s requires two operands", mnemonic)
+		}
+
+		x, ok := vReg(operands[0])
+		if !ok {
+			return nil, fmt.Errorf("%s requires a V register", mnemonic)
+		}
+
+		if y, ok := vReg(operands[1]); ok {
+			if mnemonic == "SE" {
+				return word(0x5000 | x<<8 | y<<4), nil
+			}
+
+			return word(0x9000 | x<<8 | y<<4), nil
+		}
+
+		b, err := resolve(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if mnemonic == "SE" {
+			return word(0x3000 | x<<8 | uint(b)&0xFF), nil
+		}
+
+		return word(0x4000 | x<<8 | uint(b)&0xFF), nil
+	case "SGT":
+		return vv(0x5001)
+	case "SLT":
+		return vv(0x9004)
+	case "SKP":
+		x, ok := vOnly()
+		if !ok {
+			return nil, fmt.Errorf("SKP requires a V register")
+		}
+
+		return word(0xE09E | x<<8), nil
+	case "SKNP":
+		x, ok := vOnly()
+		if !ok {
+			return nil, fmt.Errorf("SKNP requires a V register")
+		}
+
+		return word(0xE0A1 | x<<8), nil
+	case "LD":
+		return encodeLD(operands, vReg, resolve, word)
+	case "ADD":
+		if len(operands) != 2 {
+			return nil, fmt.Errorf("ADD requires two operands")
+		}
+
+		if operands[0].typ == TOKEN_I {
+			x, ok := vReg(operands[1])
+			if !ok {
+				return nil, fmt.Errorf("ADD I requires a V register")
+			}
+
+			return word(0xF01E | x<<8), nil
+		}
+
+		x, ok := vReg(operands[0])
+		if !ok {
+			return nil, fmt.Errorf("ADD requires a V register")
+		}
+
+		if y, ok := vReg(operands[1]); ok {
+			return word(0x8004 | x<<8 | y<<4), nil
+		}
+
+		b, err := resolve(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(0x7000 | x<<8 | uint(b)&0xFF), nil
+	case "OR":
+		return vv(0x8001)
+	case "AND":
+		return vv(0x8002)
+	case "XOR":
+		return vv(0x8003)
+	case "SUB":
+		return vv(0x8005)
+	case "SUBN":
+		return vv(0x8007)
+	case "SHR", "SHL":
+		if len(operands) != 1 && len(operands) != 2 {
+			return nil, fmt.Errorf("%s requires one or two V registers", mnemonic)
+		}
+
+		x, ok := vReg(operands[0])
+		if !ok {
+			return nil, fmt.Errorf("%s requires a V register", mnemonic)
+		}
+
+		y := x
+
+		if len(operands) == 2 {
+			if y, ok = vReg(operands[1]); !ok {
+				return nil, fmt.Errorf("%s requires a V register", mnemonic)
+			}
+		}
+
+		if mnemonic == "SHR" {
+			return word(0x8006 | x<<8 | y<<4), nil
+		}
+
+		return word(0x800E | x<<8 | y<<4), nil
+	case "MUL":
+		return vv(0x9001)
+	case "DIV":
+		return vv(0x9002)
+	case "BCD":
+		if len(operands) == 1 {
+			x, ok := vReg(operands[0])
+			if !ok {
+				return nil, fmt.Errorf("BCD requires a V register")
+			}
+
+			return word(0xF033 | x<<8), nil
+		}
+
+		return vv(0x9003)
+	case "RND":
+		if len(operands) != 2 {
+			return nil, fmt.Errorf("RND requires Vx, a byte literal")
+		}
+
+		x, ok := vReg(operands[0])
+		if !ok {
+			return nil, fmt.Errorf("RND requires a V register")
+		}
+
+		b, err := resolve(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(0xC000 | x<<8 | uint(b)&0xFF), nil
+	case "DRW":
+		if len(operands) != 3 {
+			return nil, fmt.Errorf("DRW requires Vx, Vy, a nibble literal")
+		}
+
+		x, xok := vReg(operands[0])
+		y, yok := vReg(operands[1])
+
+		if !xok || !yok {
+			return nil, fmt.Errorf("DRW requires two V registers")
+		}
+
+		n, err := resolve(operands[2])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(0xD000 | x<<8 | y<<4 | uint(n)&0xF), nil
+	case "LDL":
+		if len(operands) != 2 || operands[0].typ != TOKEN_I {
+			return nil, fmt.Errorf("LDL requires I, an address")
+		}
+
+		a, err := resolve(operands[1])
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte{0xF0, 0x00, byte(uint(a) >> 8), byte(a)}, nil
+	case "PLANE":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("PLANE requires a literal operand")
+		}
+
+		n, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(0xF001 | uint(n)<<8&0xF00), nil
+	case "AUDIO":
+		return word(0xF002), nil
+	case "PITCH":
+		x, ok := vOnly()
+		if !ok {
+			return nil, fmt.Errorf("PITCH requires a V register")
+		}
+
+		return word(0xF03A | x<<8), nil
+	case "ASCII":
+		if len(operands) != 1 || operands[0].typ != TOKEN_TEXT {
+			return nil, fmt.Errorf("ASCII requires a string operand")
+		}
+
+		return []byte(operands[0].val.(string)), nil
+	case "BYTE":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("BYTE requires a literal operand")
+		}
+
+		n, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return []byte{byte(n)}, nil
+	case "WORD":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("WORD requires a literal operand")
+		}
+
+		n, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		return word(uint(n)), nil
+	case "ALIGN":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("ALIGN requires a literal operand")
+		}
+
+		boundary, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if boundary <= 0 {
+			return nil, fmt.Errorf("ALIGN requires a positive literal operand")
+		}
+
+		return make([]byte, (boundary-pc%boundary)%boundary), nil
+	case "PAD":
+		if len(operands) != 1 {
+			return nil, fmt.Errorf("PAD requires a literal operand")
+		}
+
+		n, err := resolve(operands[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if n < 0 {
+			return nil, fmt.Errorf("PAD requires a non-negative literal operand")
+		}
+
+		return make([]byte, n), nil
+	}
+
+	return nil, fmt.Errorf("unknown mnemonic: %s", mnemonic)
+}
+
+/// encodeLD handles every "LD ..." operand shape: immediate/register loads,
+/// the special-purpose registers (I, DT, ST, K, F, HF, A, R), the [I]
+/// indirect store/load, and the XO-CHIP unincremented register-range
+/// save/load to [I].
+///
+func encodeLD(operands []token, vReg func(token) (uint, bool), resolve func(token) (int, error), word func(uint) []byte) ([]byte, error) {
+	switch len(operands) {
+	case 2:
+		lhs, rhs := operands[0], operands[1]
+
+		if lhs.typ == TOKEN_I {
+			a, err := resolve(rhs)
+			if err != nil {
+				return nil, err
+			}
+
+			return word(0xA000 | uint(a)&0xFFF), nil
+		}
+
+		if lhs.typ == TOKEN_DT {
+			x, ok := vReg(rhs)
+			if !ok {
+				return nil, fmt.Errorf("LD DT requires a V register")
+			}
+
+			return word(0xF015 | x<<8), nil
+		}
+
+		if lhs.typ == TOKEN_ST {
+			x, ok := vReg(rhs)
+			if !ok {
+				return nil, fmt.Errorf("LD ST requires a V register")
+			}
+
+			return word(0xF018 | x<<8), nil
+		}
+
+		if lhs.typ == TOKEN_R {
+			x, ok := vReg(rhs)
+			if !ok {
+				return nil, fmt.Errorf("LD R requires a V register")
+			}
+
+			return word(0xF075 | x<<8), nil
+		}
+
+		if lhs.typ == TOKEN_EFFECTIVE_ADDRESS {
+			x, ok := vReg(rhs)
+			if !ok {
+				return nil, fmt.Errorf("LD [I] requires a V register")
+			}
+
+			return word(0xF055 | x<<8), nil
+		}
+
+		if lhs.typ == TOKEN_F || lhs.typ == TOKEN_HF || lhs.typ == TOKEN_ASCII {
+			x, ok := vReg(rhs)
+			if !ok {
+				return nil, fmt.Errorf("LD F/HF/A requires a V register")
+			}
+
+			switch lhs.typ {
+			case TOKEN_F:
+				return word(0xF029 | x<<8), nil
+			case TOKEN_HF:
+				return word(0xF030 | x<<8), nil
+			}
+
+			return word(0xF094 | x<<8), nil
+		}
+
+		x, ok := vReg(lhs)
+		if !ok {
+			return nil, fmt.Errorf("malformed LD operands")
+		}
+
+		switch rhs.typ {
+		case TOKEN_V:
+			return word(0x8000 | x<<8 | uint(rhs.val.(int))<<4), nil
+		case TOKEN_DT:
+			return word(0xF007 | x<<8), nil
+		case TOKEN_K:
+			return word(0xF00A | x<<8), nil
+		case TOKEN_F:
+			return word(0xF029 | x<<8), nil
+		case TOKEN_HF:
+			return word(0xF030 | x<<8), nil
+		case TOKEN_ASCII:
+			return word(0xF094 | x<<8), nil
+		case TOKEN_R:
+			return word(0xF085 | x<<8), nil
+		case TOKEN_EFFECTIVE_ADDRESS:
+			return word(0xF065 | x<<8), nil
+		}
+
+		b, err := resolve(rhs)
+		if err != nil {
+			return nil, err
+		}
+
+		return word(0x6000 | x<<8 | uint(b)&0xFF), nil
+	case 3:
+		if operands[0].typ == TOKEN_EFFECTIVE_ADDRESS {
+			x, xok := vReg(operands[1])
+			y, yok := vReg(operands[2])
+
+			if !xok || !yok {
+				return nil, fmt.Errorf("LD [I], Vx, Vy requires two V registers")
+			}
+
+			return word(0x5002 | x<<8 | y<<4), nil
+		}
+
+		if operands[2].typ == TOKEN_EFFECTIVE_ADDRESS {
+			x, xok := vReg(operands[0])
+			y, yok := vReg(operands[1])
+
+			if !xok || !yok {
+				return nil, fmt.Errorf("LD Vx, Vy, [I] requires two V registers")
+			}
+
+			return word(0x5003 | x<<8 | y<<4), nil
+		}
+
+		return nil, fmt.Errorf("malformed LD operands")
+	}
+
+	return nil, fmt.Errorf("LD requires two or three operands")
+}
@@ -0,0 +1,191 @@
+package chip8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAssembleForwardLabel(t *testing.T) {
+	src := "\tCLS\n\tJP START\nSTART\n\tLD V0, #10\n"
+
+	asm, err := assembleSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0x00, 0xE0, 0x12, 0x04, 0x60, 0x10}
+
+	if !bytes.Equal(asm.Code, want) {
+		t.Errorf("got % X, want % X", asm.Code, want)
+	}
+}
+
+func TestAssembleRangeSaveLoad(t *testing.T) {
+	src := "\tLD [I], V0, V3\n\tLD V0, V3, [I]\n"
+
+	asm, err := assembleSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0x50, 0x32, 0x50, 0x33}
+
+	if !bytes.Equal(asm.Code, want) {
+		t.Errorf("got % X, want % X", asm.Code, want)
+	}
+}
+
+func TestAssembleScrollUp(t *testing.T) {
+	src := "\tSCU 3\n"
+
+	asm, err := assembleSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0x00, 0xB3}
+
+	if !bytes.Equal(asm.Code, want) {
+		t.Errorf("got % X, want % X", asm.Code, want)
+	}
+}
+
+func TestAssembleSLTRelocated(t *testing.T) {
+	src := "\tSLT V2, V5\n"
+
+	asm, err := assembleSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0x92, 0x54}
+
+	if !bytes.Equal(asm.Code, want) {
+		t.Errorf("got % X, want % X", asm.Code, want)
+	}
+}
+
+func TestDisassembleScrollUpAlias(t *testing.T) {
+	vm, err := LoadROM([]byte{0x00, 0xD5}, XOChip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := vm.Disassemble(ProgramStart)
+	want := "0200 - SCU    5"
+
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestDisassembleRangeSaveLoad(t *testing.T) {
+	vm, err := LoadROM([]byte{0x50, 0x32, 0x50, 0x33}, XOChip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := vm.Disassemble(ProgramStart), "0200 - LD     [I], V0, V3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := vm.Disassemble(ProgramStart+2), "0202 - LD     V0, V3, [I]"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAssembleUndefinedSymbol(t *testing.T) {
+	if _, err := assembleSource([]byte("\tJP NOWHERE\n")); err == nil {
+		t.Errorf("expected an error for an undefined label")
+	}
+}
+
+func TestAssembleLongLoad(t *testing.T) {
+	src := "\tLDL I, #1234\n"
+
+	asm, err := assembleSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0xF0, 0x00, 0x12, 0x34}
+
+	if !bytes.Equal(asm.Code, want) {
+		t.Errorf("got % X, want % X", asm.Code, want)
+	}
+}
+
+func TestDisassembleLongLoad(t *testing.T) {
+	vm, err := LoadROM([]byte{0xF0, 0x00, 0x12, 0x34, 0x00, 0xE0}, XOChip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := vm.Disassemble(ProgramStart), "0200 - LDL    I, #1234"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// the trailing NNNN word is part of the same instruction; the next
+	// real instruction starts 4 bytes in, not 2
+	if got, want := vm.Disassemble(ProgramStart+4), "0204 - CLS"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAssemblePlaneAudioPitch(t *testing.T) {
+	src := "\tPLANE 3\n\tAUDIO\n\tPITCH V2\n"
+
+	asm, err := assembleSource([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0xF3, 0x01, 0xF0, 0x02, 0xF2, 0x3A}
+
+	if !bytes.Equal(asm.Code, want) {
+		t.Errorf("got % X, want % X", asm.Code, want)
+	}
+}
+
+func TestDisassemblePlaneAudioPitch(t *testing.T) {
+	vm, err := LoadROM([]byte{0xF3, 0x01, 0xF0, 0x02, 0xF2, 0x3A}, XOChip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := vm.Disassemble(ProgramStart), "0200 - PLANE  3"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := vm.Disassemble(ProgramStart+2), "0202 - AUDIO"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if got, want := vm.Disassemble(ProgramStart+4), "0204 - PITCH  V2"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestProcessLongLoadAdvancesFourBytes(t *testing.T) {
+	// LDL I, #1234 ; LD V0, #99
+	vm, err := LoadROM([]byte{0xF0, 0x00, 0x12, 0x34, 0x60, 0x99}, XOChip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm.Process(false)
+
+	if vm.I != 0x1234 {
+		t.Errorf("expected I == #1234, got #%04X", vm.I)
+	}
+
+	if vm.PC != ProgramStart+4 {
+		t.Errorf("expected PC to advance 4 bytes past LDL, got #%04X", vm.PC)
+	}
+
+	vm.Process(false)
+
+	if vm.V[0] != 0x99 {
+		t.Errorf("expected the following instruction to run normally, V0 == %#x", vm.V[0])
+	}
+}
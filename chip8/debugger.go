@@ -0,0 +1,358 @@
+/* Copyright (c) 2017 Jeffrey Massung
+ *
+ * This software is provided 'as-is', without any express or implied
+ * warranty.  In no event will the authors be held liable for any damages
+ * arising from the use of this software.
+ *
+ * Permission is granted to anyone to use this software for any purpose,
+ * including commercial applications, and to alter it and redistribute it
+ * freely, subject to the following restrictions:
+ *
+ * 1. The origin of this software must not be misrepresented; you must not
+ *    claim that you wrote the original software. If you use this software
+ *    in a product, an acknowledgment in the product documentation would be
+ *    appreciated but is not required.
+ *
+ * 2. Altered source versions must be plainly marked as such, and must not be
+ *    misrepresented as being the original software.
+ *
+ * 3. This notice may not be removed or altered from any source distribution.
+ */
+
+package chip8
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/// Number of prior instructions kept around for ReverseStep.
+///
+const DebuggerHistoryLimit = 256
+
+/// A breakpoint halts execution when the program counter reaches Address,
+/// and (if Condition is non-empty) the expression evaluates true.
+///
+type DebugBreakpoint struct {
+	Address   uint
+	Condition string
+}
+
+/// A Watchpoint halts execution when memory in [Address, Address+Length) is
+/// read or written, per OnRead/OnWrite.
+///
+type Watchpoint struct {
+	Address uint
+	Length  uint
+
+	OnRead  bool
+	OnWrite bool
+}
+
+/// A RegisterWatch halts execution the instant Register takes on Value.
+///
+type RegisterWatch struct {
+	Register string
+	Value    byte
+}
+
+/// Debugger attaches breakpoints, watchpoints, and stepping controls to a
+/// running CHIP_8 virtual machine.
+///
+type Debugger struct {
+	vm *CHIP_8
+
+	Breakpoints     []DebugBreakpoint
+	Watchpoints     []Watchpoint
+	RegisterWatches []RegisterWatch
+
+	// tracks CALL/RET nesting so StepOver/StepOut know when to stop
+	callDepth int
+
+	// ring buffer of recent vm.Snapshot() states for ReverseStep
+	history      [][]byte
+	historyNext  int
+	historyCount int
+}
+
+/// NewDebugger attaches a Debugger to vm.
+///
+func NewDebugger(vm *CHIP_8) *Debugger {
+	return &Debugger{
+		vm:      vm,
+		history: make([][]byte, DebuggerHistoryLimit),
+	}
+}
+
+/// AddBreakpoint sets a (optionally conditional) breakpoint at address.
+///
+func (d *Debugger) AddBreakpoint(address uint, condition string) {
+	d.Breakpoints = append(d.Breakpoints, DebugBreakpoint{Address: address, Condition: condition})
+}
+
+/// RemoveBreakpoint clears any breakpoint at address.
+///
+func (d *Debugger) RemoveBreakpoint(address uint) {
+	for i, bp := range d.Breakpoints {
+		if bp.Address == address {
+			d.Breakpoints = append(d.Breakpoints[:i], d.Breakpoints[i+1:]...)
+
+			return
+		}
+	}
+}
+
+/// AddWatchpoint watches a memory range for reads and/or writes.
+///
+func (d *Debugger) AddWatchpoint(address, length uint, onRead, onWrite bool) {
+	d.Watchpoints = append(d.Watchpoints, Watchpoint{
+		Address: address,
+		Length:  length,
+		OnRead:  onRead,
+		OnWrite: onWrite,
+	})
+}
+
+/// AddRegisterWatch halts as soon as register takes on value.
+///
+func (d *Debugger) AddRegisterWatch(register string, value byte) {
+	d.RegisterWatches = append(d.RegisterWatches, RegisterWatch{Register: strings.ToUpper(register), Value: value})
+}
+
+/// ShouldBreak reports whether execution should halt before the instruction
+/// at pc runs, given the current register file.
+///
+func (d *Debugger) ShouldBreak(pc uint) bool {
+	for _, bp := range d.Breakpoints {
+		if bp.Address != pc {
+			continue
+		}
+
+		if bp.Condition == "" {
+			return true
+		}
+
+		if ok, err := d.evalCondition(bp.Condition); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+/// WatchRead reports whether a memory read of [addr, addr+n) should halt.
+///
+func (d *Debugger) WatchRead(addr, n uint) bool {
+	for _, w := range d.Watchpoints {
+		if w.OnRead && rangesOverlap(addr, n, w.Address, w.Length) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/// WatchWrite reports whether a memory write of [addr, addr+n) should halt.
+///
+func (d *Debugger) WatchWrite(addr, n uint) bool {
+	for _, w := range d.Watchpoints {
+		if w.OnWrite && rangesOverlap(addr, n, w.Address, w.Length) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func rangesOverlap(a1, n1, a2, n2 uint) bool {
+	return a1 < a2+n2 && a2 < a1+n1
+}
+
+/// ShouldBreakOnAccess reports whether a memory access made by the most
+/// recently processed instruction should halt execution, per the watched
+/// address ranges.
+///
+func (d *Debugger) ShouldBreakOnAccess(access MemoryAccess) bool {
+	if access.Length == 0 {
+		return false
+	}
+
+	if access.Write {
+		return d.WatchWrite(access.Address, access.Length)
+	}
+
+	return d.WatchRead(access.Address, access.Length)
+}
+
+/// ShouldBreakOnRegisters reports whether any watched register currently
+/// holds its watched value.
+///
+func (d *Debugger) ShouldBreakOnRegisters() bool {
+	for _, rw := range d.RegisterWatches {
+		if v, err := d.registerValue(rw.Register); err == nil && v == int(rw.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+/// RecordStep pushes the current VM state into the reverse-step history.
+/// Call this once per retired instruction, before mutating the VM further.
+///
+func (d *Debugger) RecordStep() {
+	d.history[d.historyNext] = d.vm.Snapshot()
+	d.historyNext = (d.historyNext + 1) % len(d.history)
+
+	if d.historyCount < len(d.history) {
+		d.historyCount++
+	}
+
+	// CALL/RET tracking for StepOver/StepOut
+	switch d.vm.Memory[d.vm.PC] & 0xF0 {
+	case 0x20:
+		d.callDepth++
+	case 0x00:
+		if d.vm.Memory[d.vm.PC+1] == 0xEE {
+			d.callDepth--
+		}
+	}
+}
+
+/// ReverseStep rewinds the VM by n previously recorded instructions. It's an
+/// error to rewind further back than the history buffer holds.
+///
+func (d *Debugger) ReverseStep(n int) error {
+	if n <= 0 {
+		return fmt.Errorf("reverse-step count must be positive")
+	}
+
+	if n > d.historyCount {
+		return fmt.Errorf("only %d instructions of history are available", d.historyCount)
+	}
+
+	i := (d.historyNext - n + len(d.history)) % len(d.history)
+
+	if err := d.vm.Restore(d.history[i]); err != nil {
+		return err
+	}
+
+	d.historyCount -= n
+	d.historyNext = i
+
+	return nil
+}
+
+/// StepInto executes exactly one instruction, descending into calls.
+///
+func (d *Debugger) StepInto() {
+	d.RecordStep()
+	d.vm.Process(false)
+}
+
+/// StepRunawayLimit bounds StepOver/StepOut so a subroutine that never
+/// returns (or an off-by-one in a ROM's own stack discipline) can't hang
+/// the debugger forever.
+///
+const StepRunawayLimit = 1000000
+
+/// StepOver executes one instruction, running through (but not into) a CALL.
+///
+func (d *Debugger) StepOver() {
+	depth := d.callDepth
+
+	d.RecordStep()
+	d.vm.Process(false)
+
+	for i := 0; d.callDepth > depth && i < StepRunawayLimit; i++ {
+		d.RecordStep()
+		d.vm.Process(false)
+	}
+}
+
+/// StepOut runs until the current call frame returns.
+///
+func (d *Debugger) StepOut() {
+	depth := d.callDepth
+
+	for i := 0; i < StepRunawayLimit; i++ {
+		d.RecordStep()
+		d.vm.Process(false)
+
+		if d.callDepth < depth {
+			break
+		}
+	}
+}
+
+/// evalCondition evaluates a simple comparison expression over V0-VF, I, DT,
+/// and ST, e.g. "V0 == 10", "I != #300", "VF > 0". It's deliberately tiny:
+/// a single left-hand register, an operator, and a right-hand literal.
+///
+func (d *Debugger) evalCondition(expr string) (bool, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 3 {
+		return false, fmt.Errorf("malformed condition: %q", expr)
+	}
+
+	lhs, err := d.registerValue(fields[0])
+	if err != nil {
+		return false, err
+	}
+
+	rhs, err := parseLiteral(fields[2])
+	if err != nil {
+		return false, err
+	}
+
+	switch fields[1] {
+	case "==":
+		return lhs == rhs, nil
+	case "!=":
+		return lhs != rhs, nil
+	case ">":
+		return lhs > rhs, nil
+	case "<":
+		return lhs < rhs, nil
+	case ">=":
+		return lhs >= rhs, nil
+	case "<=":
+		return lhs <= rhs, nil
+	}
+
+	return false, fmt.Errorf("unknown operator: %q", fields[1])
+}
+
+func (d *Debugger) registerValue(name string) (int, error) {
+	name = strings.ToUpper(name)
+
+	switch name {
+	case "I":
+		return int(d.vm.I), nil
+	case "DT":
+		return int(d.vm.DT), nil
+	case "ST":
+		return int(d.vm.ST), nil
+	}
+
+	if len(name) == 2 && name[0] == 'V' {
+		if n, err := strconv.ParseInt(string(name[1]), 16, 32); err == nil {
+			return int(d.vm.V[n]), nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown register: %q", name)
+}
+
+func parseLiteral(s string) (int, error) {
+	if strings.HasPrefix(s, "#") {
+		n, err := strconv.ParseInt(s[1:], 16, 32)
+
+		return int(n), err
+	}
+
+	n, err := strconv.ParseInt(s, 10, 32)
+
+	return int(n), err
+}
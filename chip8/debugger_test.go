@@ -0,0 +1,127 @@
+package chip8
+
+import "testing"
+
+func TestShouldBreakUnconditional(t *testing.T) {
+	vm, _ := LoadROM([]byte{0x00, 0xE0}, XOChip)
+	d := NewDebugger(vm)
+
+	d.AddBreakpoint(ProgramStart, "")
+
+	if !d.ShouldBreak(ProgramStart) {
+		t.Errorf("expected an unconditional breakpoint to fire")
+	}
+
+	if d.ShouldBreak(ProgramStart + 2) {
+		t.Errorf("expected no breakpoint at an unset address")
+	}
+}
+
+func TestShouldBreakConditional(t *testing.T) {
+	vm, _ := LoadROM([]byte{0x00, 0xE0}, XOChip)
+	d := NewDebugger(vm)
+
+	vm.V[0] = 5
+
+	d.AddBreakpoint(ProgramStart, "V0 == 5")
+
+	if !d.ShouldBreak(ProgramStart) {
+		t.Errorf("expected the condition to be satisfied")
+	}
+
+	vm.V[0] = 6
+
+	if d.ShouldBreak(ProgramStart) {
+		t.Errorf("expected the condition to no longer be satisfied")
+	}
+}
+
+func TestWatchpoints(t *testing.T) {
+	vm, _ := LoadROM([]byte{0x00, 0xE0}, XOChip)
+	d := NewDebugger(vm)
+
+	d.AddWatchpoint(0x300, 16, true, false)
+
+	if !d.WatchRead(0x305, 4) {
+		t.Errorf("expected an overlapping read to be watched")
+	}
+
+	if d.WatchWrite(0x305, 4) {
+		t.Errorf("write-only access shouldn't trip a read-only watchpoint")
+	}
+
+	if d.WatchRead(0x400, 4) {
+		t.Errorf("non-overlapping range shouldn't be watched")
+	}
+}
+
+func TestRegisterWatch(t *testing.T) {
+	vm, _ := LoadROM([]byte{0x00, 0xE0}, XOChip)
+	d := NewDebugger(vm)
+
+	d.AddRegisterWatch("V3", 9)
+
+	if d.ShouldBreakOnRegisters() {
+		t.Errorf("expected no register watch to fire yet")
+	}
+
+	vm.V[3] = 9
+
+	if !d.ShouldBreakOnRegisters() {
+		t.Errorf("expected the register watch to fire")
+	}
+}
+
+func TestReverseStep(t *testing.T) {
+	vm, _ := LoadROM([]byte{0x60, 0x01, 0x60, 0x02}, XOChip)
+	d := NewDebugger(vm)
+
+	d.RecordStep()
+	vm.Process(false) // LD V0, #1
+
+	d.RecordStep()
+	vm.Process(false) // LD V0, #2
+
+	if vm.V[0] != 2 {
+		t.Fatalf("expected V0 == 2, got %d", vm.V[0])
+	}
+
+	if err := d.ReverseStep(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if vm.V[0] != 1 {
+		t.Errorf("expected V0 == 1 after reverse-step, got %d", vm.V[0])
+	}
+
+	if err := d.ReverseStep(100); err == nil {
+		t.Errorf("expected an error rewinding past recorded history")
+	}
+}
+
+func TestStepOverSkipsCall(t *testing.T) {
+	// 0200: CALL 0206 ; 0202: LD V0, #1 ; 0204: CLS ; 0206: RET
+	vm, _ := LoadROM([]byte{0x22, 0x06, 0x60, 0x01, 0x00, 0xE0, 0x00, 0xEE}, XOChip)
+	d := NewDebugger(vm)
+
+	d.StepOver()
+
+	if vm.PC != ProgramStart+2 {
+		t.Errorf("expected StepOver to land back after the CALL, got PC #%04X", vm.PC)
+	}
+}
+
+func TestStepOutReturnsFromCall(t *testing.T) {
+	// 0200: CALL 0204 ; 0202: CLS ; 0204: RET
+	vm, _ := LoadROM([]byte{0x22, 0x04, 0x00, 0xE0, 0x00, 0xEE}, XOChip)
+	d := NewDebugger(vm)
+
+	d.RecordStep()
+	vm.Process(false) // CALL 0204
+
+	d.StepOut()
+
+	if vm.PC != ProgramStart+2 {
+		t.Errorf("expected StepOut to return to the caller, got PC #%04X", vm.PC)
+	}
+}
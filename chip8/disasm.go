@@ -49,6 +49,15 @@ func (vm *CHIP_8) Disassemble(i uint) string {
 	x := inst >> 8 & 0xF
 	y := inst >> 4 & 0xF
 
+	// XO-CHIP: F000 NNNN is a 4-byte instruction; the next word is the
+	// literal address loaded into I. Callers looping over Disassemble
+	// must advance the program counter by 4 instead of 2 for this one.
+	if inst == 0xF000 && int(i) < len(vm.Memory)-3 {
+		nnnn := uint(vm.Memory[i+2])<<8 | uint(vm.Memory[i+3])
+
+		return fmt.Sprintf("%04X - LDL    I, #%04X", i, nnnn)
+	}
+
 	// instruction decoding
 	if inst == 0x00E0 {
 		return fmt.Sprintf("%04X - CLS", i)
@@ -64,7 +73,9 @@ func (vm *CHIP_8) Disassemble(i uint) string {
 		return fmt.Sprintf("%04X - SCL", i)
 	} else if inst == 0x00FD {
 		return fmt.Sprintf("%04X - EXIT", i)
-	} else if inst&0xFFF0 == 0x00B0 {
+	} else if inst&0xFFF0 == 0x00B0 || inst&0xFFF0 == 0x00D0 {
+		// 00DN is XO-CHIP's own encoding for "scroll up N"; accept it as an
+		// alias of the pre-existing 00BN.
 		return fmt.Sprintf("%04X - SCU    %d", i, n)
 	} else if inst&0xFFF0 == 0x00C0 {
 		return fmt.Sprintf("%04X - SCD    %d", i, n)
@@ -83,7 +94,9 @@ func (vm *CHIP_8) Disassemble(i uint) string {
 	} else if inst&0xF00F == 0x5001 {
 		return fmt.Sprintf("%04X - SGT    V%X, V%X", i, x, y)
 	} else if inst&0xF00F == 0x5002 {
-		return fmt.Sprintf("%04X - SLT    V%X, V%X", i, x, y)
+		return fmt.Sprintf("%04X - LD     [I], V%X, V%X", i, x, y)
+	} else if inst&0xF00F == 0x5003 {
+		return fmt.Sprintf("%04X - LD     V%X, V%X, [I]", i, x, y)
 	} else if inst&0xF000 == 0x6000 {
 		return fmt.Sprintf("%04X - LD     V%X, #%02X", i, x, b)
 	} else if inst&0xF000 == 0x7000 {
@@ -114,6 +127,8 @@ func (vm *CHIP_8) Disassemble(i uint) string {
 		return fmt.Sprintf("%04X - DIV    V%X, V%X", i, x, y)
 	} else if inst&0xF00F == 0x9003 {
 		return fmt.Sprintf("%04X - BCD    V%X, V%X", i, x, y)
+	} else if inst&0xF00F == 0x9004 {
+		return fmt.Sprintf("%04X - SLT    V%X, V%X", i, x, y)
 	} else if inst&0xF000 == 0xA000 {
 		return fmt.Sprintf("%04X - LD     I, #%04X", i, a)
 	} else if inst&0xF000 == 0xB000 {
@@ -152,6 +167,12 @@ func (vm *CHIP_8) Disassemble(i uint) string {
 		return fmt.Sprintf("%04X - LD     V%X, R", i, x)
 	} else if inst&0xF0FF == 0xF094 {
 		return fmt.Sprintf("%04X - LD     A, V%X", i, x)
+	} else if inst == 0xF002 {
+		return fmt.Sprintf("%04X - AUDIO", i)
+	} else if inst&0xF0FF == 0xF001 {
+		return fmt.Sprintf("%04X - PLANE  %d", i, x)
+	} else if inst&0xF0FF == 0xF03A {
+		return fmt.Sprintf("%04X - PITCH  V%X", i, x)
 	}
 
 	// unknown instruction
@@ -0,0 +1,126 @@
+/* Copyright (c) 2017 Jeffrey Massung
+ *
+ * This software is provided 'as-is', without any express or implied
+ * warranty.  In no event will the authors be held liable for any damages
+ * arising from the use of this software.
+ *
+ * Permission is granted to anyone to use this software for any purpose,
+ * including commercial applications, and to alter it and redistribute it
+ * freely, subject to the following restrictions:
+ *
+ * 1. The origin of this software must not be misrepresented; you must not
+ *    claim that you wrote the original software. If you use this software
+ *    in a product, an acknowledgment in the product documentation would be
+ *    appreciated but is not required.
+ *
+ * 2. Altered source versions must be plainly marked as such, and must not be
+ *    misrepresented as being the original software.
+ *
+ * 3. This notice may not be removed or altered from any source distribution.
+ */
+
+package chip8
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+/// Quirks captures the behavioral differences between historical CHIP-8
+/// interpreters. A zero-value Quirks is the modern/permissive behavior;
+/// set fields to true to opt into the quirkier, older behavior.
+///
+type Quirks struct {
+	// SHR/SHL shift VY into VX instead of shifting VX in place.
+	ShiftVY bool
+
+	// LD [I], Vx / LD Vx, [I] leave I unchanged instead of incrementing it.
+	LoadNoIncrement bool
+
+	// Bxnn jumps to xnn + VX, X being the opcode's second nibble,
+	// instead of always using nnn + V0.
+	JumpVX bool
+
+	// sprites clip at the edge of the screen instead of wrapping around.
+	ClipSprites bool
+
+	// AND/OR/XOR reset VF to 0 instead of leaving it untouched.
+	VfReset bool
+
+	// after a DXYN draw, no further instruction runs until the next
+	// vertical blank, instead of execution continuing immediately.
+	DisplayWait bool
+}
+
+/// Named, historically accurate platform profiles.
+///
+var (
+	CosmacVIP = Quirks{
+		ShiftVY:         true,
+		LoadNoIncrement: false,
+		JumpVX:          false,
+		ClipSprites:     true,
+		VfReset:         true,
+		DisplayWait:     true,
+	}
+
+	SuperChip1_1 = Quirks{
+		ShiftVY:         false,
+		LoadNoIncrement: true,
+		JumpVX:          true,
+		ClipSprites:     true,
+		VfReset:         false,
+		DisplayWait:     false,
+	}
+
+	XOChip = Quirks{
+		ShiftVY:         false,
+		LoadNoIncrement: false,
+		JumpVX:          false,
+		ClipSprites:     false,
+		VfReset:         false,
+		DisplayWait:     false,
+	}
+)
+
+/// Profiles maps a `-profile` flag value to its Quirks.
+///
+var Profiles = map[string]Quirks{
+	"cosmac-vip": CosmacVIP,
+	"schip":      SuperChip1_1,
+	"schip1.1":   SuperChip1_1,
+	"xo-chip":    XOChip,
+}
+
+/// Profile looks up a named platform profile. Matching is case-insensitive.
+/// Returns false if the name isn't recognized.
+///
+func Profile(name string) (Quirks, bool) {
+	q, ok := Profiles[strings.ToLower(name)]
+
+	return q, ok
+}
+
+/// LoadQuirksSidecar reads a per-ROM quirks override file sitting next to a
+/// ROM (e.g. "pong.rom" -> "pong.rom.quirks.json") and applies any fields it
+/// sets on top of the base Quirks. It's not an error for the sidecar to not
+/// exist; any other read error, or malformed JSON, is reported.
+///
+func LoadQuirksSidecar(romPath string, base Quirks) (Quirks, error) {
+	data, err := ioutil.ReadFile(romPath + ".quirks.json")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return base, nil
+		}
+
+		return base, err
+	}
+
+	if err := json.Unmarshal(data, &base); err != nil {
+		return base, err
+	}
+
+	return base, nil
+}
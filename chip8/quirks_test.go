@@ -0,0 +1,69 @@
+package chip8
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	for _, name := range []string{"cosmac-vip", "COSMAC-VIP", "schip1.1", "xo-chip"} {
+		if _, ok := Profile(name); !ok {
+			t.Errorf("Profile(%q) not found", name)
+		}
+	}
+
+	if _, ok := Profile("not-a-profile"); ok {
+		t.Errorf("Profile(\"not-a-profile\") unexpectedly found")
+	}
+}
+
+func TestLoadQuirksSidecarMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8-quirks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	rom := filepath.Join(dir, "pong.rom")
+
+	q, err := LoadQuirksSidecar(rom, CosmacVIP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if q != CosmacVIP {
+		t.Errorf("expected base quirks unchanged, got %+v", q)
+	}
+}
+
+func TestLoadQuirksSidecarOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chip8-quirks")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	rom := filepath.Join(dir, "pong.rom")
+	sidecar := rom + ".quirks.json"
+
+	if err := ioutil.WriteFile(sidecar, []byte(`{"ClipSprites": false}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := LoadQuirksSidecar(rom, CosmacVIP)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if q.ClipSprites {
+		t.Errorf("expected sidecar to clear ClipSprites")
+	}
+
+	if !q.VfReset {
+		t.Errorf("expected unmentioned fields to keep the base value")
+	}
+}
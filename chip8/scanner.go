@@ -284,6 +284,8 @@ func (s *tokenScanner) scanIdentifier() token {
 		return token{typ: TOKEN_ST}
 	case "CLS", "RET", "EXIT", "LOW", "HIGH", "SCU", "SCD", "SCR", "SCL", "SYS", "JP", "CALL", "SE", "SNE", "SGT", "SLT", "SKP", "SKNP", "LD", "OR", "AND", "XOR", "ADD", "SUB", "SUBN", "MUL", "DIV", "SHR", "SHL", "BCD", "RND", "DRW":
 		return token{typ: TOKEN_INSTRUCTION, val: id}
+	case "LDL", "PLANE", "AUDIO", "PITCH":
+		return token{typ: TOKEN_INSTRUCTION, val: id}
 	case "ASCII", "BYTE", "WORD", "ALIGN", "PAD":
 		return token{typ: TOKEN_INSTRUCTION, val: id}
 	case "BREAK":
@@ -0,0 +1,243 @@
+/* Copyright (c) 2017 Jeffrey Massung
+ *
+ * This software is provided 'as-is', without any express or implied
+ * warranty.  In no event will the authors be held liable for any damages
+ * arising from the use of this software.
+ *
+ * Permission is granted to anyone to use this software for any purpose,
+ * including commercial applications, and to alter it and redistribute it
+ * freely, subject to the following restrictions:
+ *
+ * 1. The origin of this software must not be misrepresented; you must not
+ *    claim that you wrote the original software. If you use this software
+ *    in a product, an acknowledgment in the product documentation would be
+ *    appreciated but is not required.
+ *
+ * 2. Altered source versions must be plainly marked as such, and must not be
+ *    misrepresented as being the original software.
+ *
+ * 3. This notice may not be removed or altered from any source distribution.
+ */
+
+package chip8
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+/// Magic number and current version of the Snapshot wire format. Bump
+/// snapshotVersion whenever the layout below changes.
+///
+const (
+	snapshotMagic   = 0xC8C8
+	snapshotVersion = 2
+)
+
+/// Snapshot serializes the entire machine state - RAM, registers, the call
+/// stack, the framebuffer, key state, and quirk settings - into a single
+/// versioned byte slice suitable for a quicksave or a rewind ring buffer.
+/// The interpreter's internal run state (halted by EXIT, a pending
+/// DisplayWait pause, the timer phase) is not included, and Restore leaves
+/// it as it is.
+///
+func (vm *CHIP_8) Snapshot() []byte {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, uint16(snapshotMagic))
+	binary.Write(&buf, binary.BigEndian, uint16(snapshotVersion))
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(vm.Memory)))
+	buf.Write(vm.Memory)
+
+	buf.Write(vm.V[:])
+	binary.Write(&buf, binary.BigEndian, uint16(vm.I))
+	buf.WriteByte(vm.DT)
+	buf.WriteByte(vm.ST)
+	binary.Write(&buf, binary.BigEndian, uint16(vm.PC))
+	binary.Write(&buf, binary.BigEndian, uint16(vm.SP))
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(vm.Stack)))
+	for _, addr := range vm.Stack {
+		binary.Write(&buf, binary.BigEndian, uint16(addr))
+	}
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(vm.Display)))
+	buf.Write(vm.Display)
+
+	for _, down := range vm.Keys {
+		if down {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	}
+
+	buf.Write(vm.R[:])
+
+	// XO-CHIP extensions: selected draw planes, the audio pattern buffer,
+	// and the playback pitch register
+	buf.WriteByte(vm.Planes)
+	buf.Write(vm.Audio[:])
+	buf.WriteByte(vm.Pitch)
+
+	binary.Write(&buf, binary.BigEndian, vm.Quirks)
+
+	return buf.Bytes()
+}
+
+/// Restore replaces the machine state with one previously produced by
+/// Snapshot. It returns an error if data isn't a recognized, compatible
+/// snapshot.
+///
+func (vm *CHIP_8) Restore(data []byte) error {
+	buf := bytes.NewReader(data)
+
+	var magic, version uint16
+
+	if err := binary.Read(buf, binary.BigEndian, &magic); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	if magic != snapshotMagic {
+		return fmt.Errorf("snapshot: bad magic number #%04X", magic)
+	}
+
+	if err := binary.Read(buf, binary.BigEndian, &version); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	if version != snapshotVersion {
+		return fmt.Errorf("snapshot: unsupported version %d", version)
+	}
+
+	var memLen uint32
+
+	if err := binary.Read(buf, binary.BigEndian, &memLen); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	memory := make([]byte, memLen)
+
+	if _, err := buf.Read(memory); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	var v [16]byte
+
+	if _, err := buf.Read(v[:]); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	var i, pc, sp uint16
+	var dt, st byte
+	var err error
+
+	if err = binary.Read(buf, binary.BigEndian, &i); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	if dt, err = buf.ReadByte(); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	if st, err = buf.ReadByte(); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	if err := binary.Read(buf, binary.BigEndian, &pc); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	if err := binary.Read(buf, binary.BigEndian, &sp); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	var stackLen uint32
+
+	if err := binary.Read(buf, binary.BigEndian, &stackLen); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	stack := make([]uint, stackLen)
+
+	for n := range stack {
+		var addr uint16
+
+		if err := binary.Read(buf, binary.BigEndian, &addr); err != nil {
+			return fmt.Errorf("snapshot: %v", err)
+		}
+
+		stack[n] = uint(addr)
+	}
+
+	var displayLen uint32
+
+	if err := binary.Read(buf, binary.BigEndian, &displayLen); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	display := make([]byte, displayLen)
+
+	if _, err := buf.Read(display); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	keys := make([]bool, len(vm.Keys))
+
+	for n := range keys {
+		b, err := buf.ReadByte()
+		if err != nil {
+			return fmt.Errorf("snapshot: %v", err)
+		}
+
+		keys[n] = b != 0
+	}
+
+	var r [8]byte
+
+	if _, err := buf.Read(r[:]); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	planes, err := buf.ReadByte()
+	if err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	var audio [16]byte
+
+	if _, err := buf.Read(audio[:]); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	pitch, err := buf.ReadByte()
+	if err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	var quirks Quirks
+
+	if err := binary.Read(buf, binary.BigEndian, &quirks); err != nil {
+		return fmt.Errorf("snapshot: %v", err)
+	}
+
+	vm.Memory = memory
+	vm.V = v
+	vm.I = uint(i)
+	vm.DT = dt
+	vm.ST = st
+	vm.PC = uint(pc)
+	vm.SP = uint(sp)
+	vm.Stack = stack
+	vm.Display = display
+	vm.Keys = keys
+	vm.R = r
+	vm.Planes = planes
+	vm.Audio = audio
+	vm.Pitch = pitch
+	vm.Quirks = quirks
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package chip8
+
+import "testing"
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	vm, _ := LoadROM([]byte{0x60, 0x2A, 0x22, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0xEE}, XOChip)
+
+	for n := 0; n < 2; n++ {
+		vm.Process(false)
+	}
+
+	before := vm.Snapshot()
+
+	// run a few more cycles so the live machine diverges from the snapshot
+	for n := 0; n < 4; n++ {
+		vm.Process(false)
+	}
+
+	if err := vm.Restore(before); err != nil {
+		t.Fatal(err)
+	}
+
+	after := vm.Snapshot()
+
+	if len(before) != len(after) {
+		t.Fatalf("snapshot length changed across a restore: %d vs %d", len(before), len(after))
+	}
+
+	for i := range before {
+		if before[i] != after[i] {
+			t.Fatalf("snapshot byte %d differs after restore: %#x vs %#x", i, before[i], after[i])
+		}
+	}
+}
+
+func TestSnapshotBadMagic(t *testing.T) {
+	vm, _ := LoadROM([]byte{0x00, 0xE0}, XOChip)
+
+	if err := vm.Restore([]byte{0xDE, 0xAD}); err == nil {
+		t.Errorf("expected an error restoring from garbage data")
+	}
+}
@@ -0,0 +1,642 @@
+/* Copyright (c) 2017 Jeffrey Massung
+ *
+ * This software is provided 'as-is', without any express or implied
+ * warranty.  In no event will the authors be held liable for any damages
+ * arising from the use of this software.
+ *
+ * Permission is granted to anyone to use this software for any purpose,
+ * including commercial applications, and to alter it and redistribute it
+ * freely, subject to the following restrictions:
+ *
+ * 1. The origin of this software must not be misrepresented; you must not
+ *    claim that you wrote the original software. If you use this software
+ *    in a product, an acknowledgment in the product documentation would be
+ *    appreciated but is not required.
+ *
+ * 2. Altered source versions must be plainly marked as such, and must not be
+ *    misrepresented as being the original software.
+ *
+ * 3. This notice may not be removed or altered from any source distribution.
+ */
+
+package chip8
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+)
+
+const (
+	MemorySize    = 4096
+	ProgramStart  = 0x200
+	StackDepth    = 16
+	DisplayWidth  = 128
+	DisplayHeight = 64
+)
+
+/// The built-in small (4x5) hex digit font, loaded at the start of RAM.
+///
+var smallFont = [16 * 5]byte{
+	0xF0, 0x90, 0x90, 0x90, 0xF0, // 0
+	0x20, 0x60, 0x20, 0x20, 0x70, // 1
+	0xF0, 0x10, 0xF0, 0x80, 0xF0, // 2
+	0xF0, 0x10, 0xF0, 0x10, 0xF0, // 3
+	0x90, 0x90, 0xF0, 0x10, 0x10, // 4
+	0xF0, 0x80, 0xF0, 0x10, 0xF0, // 5
+	0xF0, 0x80, 0xF0, 0x90, 0xF0, // 6
+	0xF0, 0x10, 0x20, 0x40, 0x40, // 7
+	0xF0, 0x90, 0xF0, 0x90, 0xF0, // 8
+	0xF0, 0x90, 0xF0, 0x10, 0xF0, // 9
+	0xF0, 0x90, 0xF0, 0x90, 0x90, // A
+	0xE0, 0x90, 0xE0, 0x90, 0xE0, // B
+	0xF0, 0x80, 0x80, 0x80, 0xF0, // C
+	0xE0, 0x90, 0x90, 0x90, 0xE0, // D
+	0xF0, 0x80, 0xF0, 0x80, 0xF0, // E
+	0xF0, 0x80, 0xF0, 0x80, 0x80, // F
+}
+
+/// Where the small font is loaded in RAM.
+///
+const smallFontAddress = 0x50
+
+/// Breakpoint is returned by Process when execution reaches a BREAK
+/// assembled into the ROM.
+///
+type Breakpoint struct {
+	Address uint
+}
+
+func (b Breakpoint) Error() string {
+	return fmt.Sprintf("breakpoint at #%04X", b.Address)
+}
+
+/// MemoryAccess records the most recent range access made to RAM via [I],
+/// so a Debugger can check it against watchpoints after the fact.
+///
+type MemoryAccess struct {
+	Address uint
+	Length  uint
+	Write   bool
+}
+
+/// CHIP_8 is a single virtual machine: its RAM, registers, call stack,
+/// framebuffer, keypad, and the quirks it was loaded with.
+///
+type CHIP_8 struct {
+	Memory []byte
+
+	V  [16]byte
+	I  uint
+	DT byte
+	ST byte
+	PC uint
+	SP uint
+
+	Stack []uint
+
+	Display []byte
+	Keys    []bool
+
+	// HP48 flags registers (LD R, Vx / LD Vx, R).
+	R [8]byte
+
+	// XO-CHIP extensions.
+	Planes byte
+	Audio  [16]byte
+	Pitch  byte
+
+	Quirks Quirks
+
+	// LastAccess is set whenever an instruction reads or writes a range of
+	// RAM through [I], so a Debugger can check it for watchpoints.
+	LastAccess MemoryAccess
+
+	halted     bool
+	timerTicks int
+
+	// set by a DXYN draw when Quirks.DisplayWait is on; Process won't
+	// execute another instruction until the next vertical blank
+	waitingVBlank bool
+}
+
+/// newVM allocates a fresh machine with the given quirks, font loaded, and
+/// program counter at the start of user RAM.
+///
+func newVM(quirks Quirks) *CHIP_8 {
+	vm := &CHIP_8{
+		Memory:  make([]byte, MemorySize),
+		PC:      ProgramStart,
+		Stack:   make([]uint, 0, StackDepth),
+		Display: make([]byte, DisplayWidth*DisplayHeight),
+		Keys:    make([]bool, 16),
+		Planes:  1,
+		Quirks:  quirks,
+	}
+
+	copy(vm.Memory[smallFontAddress:], smallFont[:])
+
+	return vm
+}
+
+/// LoadROM loads raw CHIP-8 program bytes into a fresh machine.
+///
+func LoadROM(rom []byte, quirks Quirks) (*CHIP_8, error) {
+	vm := newVM(quirks)
+
+	if len(rom) > len(vm.Memory)-ProgramStart {
+		return nil, fmt.Errorf("ROM too large: %d bytes", len(rom))
+	}
+
+	copy(vm.Memory[ProgramStart:], rom)
+
+	return vm, nil
+}
+
+/// LoadFile reads a ROM from disk and loads it.
+///
+func LoadFile(path string, quirks Quirks) (*CHIP_8, error) {
+	rom, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadROM(rom, quirks)
+}
+
+/// LoadAssembly loads the machine code produced by Assemble.
+///
+func LoadAssembly(asm *Assembly, quirks Quirks) (*CHIP_8, error) {
+	return LoadROM(asm.Code, quirks)
+}
+
+/// Process executes a single instruction (unless paused) and returns either
+/// nil, a Breakpoint, or the MemoryAccess the instruction made through [I]
+/// (for the caller to check against watchpoints).
+///
+func (vm *CHIP_8) Process(paused bool) interface{} {
+	if paused || vm.halted {
+		return nil
+	}
+
+	vm.LastAccess = MemoryAccess{}
+
+	// the 60 Hz timers run roughly once every 8 instructions at the
+	// traditional ~500 Hz CHIP-8 clock rate; this doubles as the vertical
+	// blank a DisplayWait quirk draw is waiting on
+	vm.timerTicks++
+	vblank := vm.timerTicks >= 8
+
+	if vblank {
+		vm.timerTicks = 0
+
+		if vm.DT > 0 {
+			vm.DT--
+		}
+
+		if vm.ST > 0 {
+			vm.ST--
+		}
+	}
+
+	if vm.waitingVBlank {
+		if !vblank {
+			return nil
+		}
+
+		vm.waitingVBlank = false
+	}
+
+	if int(vm.PC) >= len(vm.Memory)-1 {
+		vm.halted = true
+
+		return nil
+	}
+
+	inst := uint(vm.Memory[vm.PC])<<8 | uint(vm.Memory[vm.PC+1])
+
+	// a BREAK assembled into the ROM halts execution without advancing PC
+	if inst == 0x0001 {
+		return Breakpoint{Address: vm.PC}
+	}
+
+	vm.PC += 2
+
+	vm.execute(inst)
+
+	return vm.watchResult()
+}
+
+func (vm *CHIP_8) watchResult() interface{} {
+	if vm.LastAccess.Length == 0 {
+		return nil
+	}
+
+	return vm.LastAccess
+}
+
+func (vm *CHIP_8) execute(inst uint) {
+	a := inst & 0xFFF
+	b := byte(inst & 0xFF)
+	n := byte(inst & 0xF)
+	x := inst >> 8 & 0xF
+	y := inst >> 4 & 0xF
+
+	switch {
+	case inst == 0xF000:
+		// same 4-byte encoding Disassemble guards against running off the
+		// end of RAM for
+		if int(vm.PC)+1 < len(vm.Memory) {
+			vm.I = uint(vm.Memory[vm.PC])<<8 | uint(vm.Memory[vm.PC+1])
+		}
+
+		vm.PC += 2
+	case inst == 0x00E0:
+		for i := range vm.Display {
+			vm.Display[i] &^= vm.Planes
+		}
+	case inst == 0x00EE:
+		vm.ret()
+	case inst == 0x00FE, inst == 0x00FF:
+		// LOW/HIGH: resolution switch; framebuffer is always full-size.
+	case inst == 0x00FB:
+		vm.scrollX(4)
+	case inst == 0x00FC:
+		vm.scrollX(-4)
+	case inst == 0x00FD:
+		vm.halted = true
+	case inst&0xFFF0 == 0x00B0, inst&0xFFF0 == 0x00D0:
+		vm.scrollY(-int(n))
+	case inst&0xFFF0 == 0x00C0:
+		vm.scrollY(int(n))
+	case inst&0xF000 == 0x0000:
+		// SYS: ignored on modern interpreters
+	case inst&0xF000 == 0x1000:
+		vm.PC = a
+	case inst&0xF000 == 0x2000:
+		vm.call(a)
+	case inst&0xF000 == 0x3000:
+		if vm.V[x] == b {
+			vm.PC += 2
+		}
+	case inst&0xF000 == 0x4000:
+		if vm.V[x] != b {
+			vm.PC += 2
+		}
+	case inst&0xF00F == 0x5000:
+		if vm.V[x] == vm.V[y] {
+			vm.PC += 2
+		}
+	case inst&0xF00F == 0x5001:
+		if vm.V[x] > vm.V[y] {
+			vm.PC += 2
+		}
+	case inst&0xF00F == 0x5002:
+		vm.saveRange(x, y)
+	case inst&0xF00F == 0x5003:
+		vm.loadRange(x, y)
+	case inst&0xF000 == 0x6000:
+		vm.V[x] = b
+	case inst&0xF000 == 0x7000:
+		vm.V[x] += b
+	case inst&0xF00F == 0x8000:
+		vm.V[x] = vm.V[y]
+	case inst&0xF00F == 0x8001:
+		vm.V[x] |= vm.V[y]
+		vm.resetVF()
+	case inst&0xF00F == 0x8002:
+		vm.V[x] &= vm.V[y]
+		vm.resetVF()
+	case inst&0xF00F == 0x8003:
+		vm.V[x] ^= vm.V[y]
+		vm.resetVF()
+	case inst&0xF00F == 0x8004:
+		sum := uint16(vm.V[x]) + uint16(vm.V[y])
+
+		vm.V[x] = byte(sum)
+		vm.V[0xF] = boolByte(sum > 0xFF)
+	case inst&0xF00F == 0x8005:
+		borrow := vm.V[x] >= vm.V[y]
+
+		vm.V[x] -= vm.V[y]
+		vm.V[0xF] = boolByte(borrow)
+	case inst&0xF00F == 0x8006:
+		vm.shiftRight(x, y)
+	case inst&0xF00F == 0x8007:
+		borrow := vm.V[y] >= vm.V[x]
+		r := vm.V[y] - vm.V[x]
+
+		vm.V[x] = r
+		vm.V[0xF] = boolByte(borrow)
+	case inst&0xF00F == 0x800E:
+		vm.shiftLeft(x, y)
+	case inst&0xF00F == 0x9000:
+		if vm.V[x] != vm.V[y] {
+			vm.PC += 2
+		}
+	case inst&0xF00F == 0x9001:
+		vm.V[x] *= vm.V[y]
+	case inst&0xF00F == 0x9002:
+		if vm.V[y] != 0 {
+			vm.V[x] /= vm.V[y]
+		}
+	case inst&0xF00F == 0x9003:
+		vm.bcd(vm.V[x])
+	case inst&0xF00F == 0x9004:
+		if vm.V[x] < vm.V[y] {
+			vm.PC += 2
+		}
+	case inst&0xF000 == 0xA000:
+		vm.I = a
+	case inst&0xF000 == 0xB000:
+		if vm.Quirks.JumpVX {
+			vm.PC = a + uint(vm.V[x])
+		} else {
+			vm.PC = a + uint(vm.V[0])
+		}
+	case inst&0xF000 == 0xC000:
+		vm.V[x] = byte(rand.Intn(256)) & b
+	case inst&0xF000 == 0xD000:
+		vm.draw(x, y, uint(n))
+
+		if vm.Quirks.DisplayWait {
+			vm.waitingVBlank = true
+		}
+	case inst&0xF0FF == 0xE09E:
+		if vm.keyDown(vm.V[x]) {
+			vm.PC += 2
+		}
+	case inst&0xF0FF == 0xE0A1:
+		if !vm.keyDown(vm.V[x]) {
+			vm.PC += 2
+		}
+	case inst&0xF0FF == 0xF007:
+		vm.V[x] = vm.DT
+	case inst&0xF0FF == 0xF00A:
+		vm.waitForKey(x)
+	case inst&0xF0FF == 0xF015:
+		vm.DT = vm.V[x]
+	case inst&0xF0FF == 0xF018:
+		vm.ST = vm.V[x]
+	case inst&0xF0FF == 0xF01E:
+		vm.I += uint(vm.V[x])
+	case inst&0xF0FF == 0xF029:
+		vm.I = smallFontAddress + uint(vm.V[x])*5
+	case inst&0xF0FF == 0xF030:
+		vm.I = smallFontAddress + uint(vm.V[x])*5
+	case inst&0xF0FF == 0xF033:
+		vm.bcd(vm.V[x])
+	case inst&0xF0FF == 0xF055:
+		vm.storeRegisters(x)
+	case inst&0xF0FF == 0xF065:
+		vm.loadRegisters(x)
+	case inst&0xF0FF == 0xF075:
+		if x < uint(len(vm.R)) {
+			vm.R[x] = vm.V[x]
+		}
+	case inst&0xF0FF == 0xF085:
+		if x < uint(len(vm.R)) {
+			vm.V[x] = vm.R[x]
+		}
+	case inst&0xF0FF == 0xF094:
+		vm.I = smallFontAddress + uint(vm.V[x])*5
+	case inst == 0xF002:
+		vm.loadAudio()
+	case inst&0xF0FF == 0xF001:
+		vm.Planes = byte(x)
+	case inst&0xF0FF == 0xF03A:
+		vm.Pitch = vm.V[x]
+	}
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func (vm *CHIP_8) resetVF() {
+	if vm.Quirks.VfReset {
+		vm.V[0xF] = 0
+	}
+}
+
+func (vm *CHIP_8) shiftRight(x, y uint) {
+	src := x
+
+	if vm.Quirks.ShiftVY {
+		src = y
+	}
+
+	carry := vm.V[src] & 0x1
+
+	vm.V[x] = vm.V[src] >> 1
+	vm.V[0xF] = carry
+}
+
+func (vm *CHIP_8) shiftLeft(x, y uint) {
+	src := x
+
+	if vm.Quirks.ShiftVY {
+		src = y
+	}
+
+	carry := (vm.V[src] >> 7) & 0x1
+
+	vm.V[x] = vm.V[src] << 1
+	vm.V[0xF] = carry
+}
+
+func (vm *CHIP_8) call(addr uint) {
+	vm.Stack = append(vm.Stack, vm.PC)
+	vm.SP = uint(len(vm.Stack))
+	vm.PC = addr
+}
+
+func (vm *CHIP_8) ret() {
+	if len(vm.Stack) == 0 {
+		return
+	}
+
+	vm.PC = vm.Stack[len(vm.Stack)-1]
+	vm.Stack = vm.Stack[:len(vm.Stack)-1]
+	vm.SP = uint(len(vm.Stack))
+}
+
+func (vm *CHIP_8) bcd(v byte) {
+	if int(vm.I)+2 >= len(vm.Memory) {
+		return
+	}
+
+	vm.LastAccess = MemoryAccess{Address: vm.I, Length: 3, Write: true}
+
+	vm.Memory[vm.I] = v / 100
+	vm.Memory[vm.I+1] = (v / 10) % 10
+	vm.Memory[vm.I+2] = v % 10
+}
+
+func (vm *CHIP_8) storeRegisters(x uint) {
+	n := x + 1
+
+	vm.LastAccess = MemoryAccess{Address: vm.I, Length: n, Write: true}
+
+	for i := uint(0); i < n && int(vm.I)+int(i) < len(vm.Memory); i++ {
+		vm.Memory[vm.I+i] = vm.V[i]
+	}
+
+	if !vm.Quirks.LoadNoIncrement {
+		vm.I += n
+	}
+}
+
+func (vm *CHIP_8) loadRegisters(x uint) {
+	n := x + 1
+
+	vm.LastAccess = MemoryAccess{Address: vm.I, Length: n, Write: false}
+
+	for i := uint(0); i < n && int(vm.I)+int(i) < len(vm.Memory); i++ {
+		vm.V[i] = vm.Memory[vm.I+i]
+	}
+
+	if !vm.Quirks.LoadNoIncrement {
+		vm.I += n
+	}
+}
+
+/// saveRange implements the XO-CHIP 5XY2: save VX..VY to [I], without
+/// incrementing I.
+///
+func (vm *CHIP_8) saveRange(x, y uint) {
+	lo, hi := x, y
+
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+
+	n := hi - lo + 1
+
+	vm.LastAccess = MemoryAccess{Address: vm.I, Length: n, Write: true}
+
+	for i := uint(0); i < n && int(vm.I)+int(i) < len(vm.Memory); i++ {
+		vm.Memory[vm.I+i] = vm.V[lo+i]
+	}
+}
+
+/// loadRange implements the XO-CHIP 5XY3: load VX..VY from [I], without
+/// incrementing I.
+///
+func (vm *CHIP_8) loadRange(x, y uint) {
+	lo, hi := x, y
+
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+
+	n := hi - lo + 1
+
+	vm.LastAccess = MemoryAccess{Address: vm.I, Length: n, Write: false}
+
+	for i := uint(0); i < n && int(vm.I)+int(i) < len(vm.Memory); i++ {
+		vm.V[lo+i] = vm.Memory[vm.I+i]
+	}
+}
+
+func (vm *CHIP_8) loadAudio() {
+	vm.LastAccess = MemoryAccess{Address: vm.I, Length: uint(len(vm.Audio)), Write: false}
+
+	for i := range vm.Audio {
+		if int(vm.I)+i < len(vm.Memory) {
+			vm.Audio[i] = vm.Memory[vm.I+uint(i)]
+		}
+	}
+}
+
+func (vm *CHIP_8) keyDown(v byte) bool {
+	if int(v) >= len(vm.Keys) {
+		return false
+	}
+
+	return vm.Keys[v]
+}
+
+func (vm *CHIP_8) waitForKey(x uint) {
+	for k, down := range vm.Keys {
+		if down {
+			vm.V[x] = byte(k)
+
+			return
+		}
+	}
+
+	// no key pressed yet; re-run this instruction next cycle
+	vm.PC -= 2
+}
+
+func (vm *CHIP_8) scrollX(dx int) {
+	vm.scrollDisplay(dx, 0)
+}
+
+func (vm *CHIP_8) scrollY(dy int) {
+	vm.scrollDisplay(0, dy)
+}
+
+func (vm *CHIP_8) scrollDisplay(dx, dy int) {
+	shifted := make([]byte, len(vm.Display))
+
+	for py := 0; py < DisplayHeight; py++ {
+		for px := 0; px < DisplayWidth; px++ {
+			sx, sy := px-dx, py-dy
+
+			if sx < 0 || sx >= DisplayWidth || sy < 0 || sy >= DisplayHeight {
+				continue
+			}
+
+			shifted[py*DisplayWidth+px] = vm.Display[sy*DisplayWidth+sx]
+		}
+	}
+
+	vm.Display = shifted
+}
+
+func (vm *CHIP_8) draw(x, y, n uint) {
+	vx, vy := uint(vm.V[x]), uint(vm.V[y])
+
+	vm.LastAccess = MemoryAccess{Address: vm.I, Length: n, Write: false}
+
+	vm.V[0xF] = 0
+
+	for row := uint(0); row < n; row++ {
+		if int(vm.I)+int(row) >= len(vm.Memory) {
+			break
+		}
+
+		sprite := vm.Memory[vm.I+row]
+
+		for col := uint(0); col < 8; col++ {
+			if sprite&(0x80>>col) == 0 {
+				continue
+			}
+
+			px, py := vx+col, vy+row
+
+			if vm.Quirks.ClipSprites {
+				if px >= DisplayWidth || py >= DisplayHeight {
+					continue
+				}
+			} else {
+				px %= DisplayWidth
+				py %= DisplayHeight
+			}
+
+			idx := py*DisplayWidth + px
+
+			if vm.Display[idx]&vm.Planes != 0 {
+				vm.V[0xF] = 1
+			}
+
+			vm.Display[idx] ^= vm.Planes
+		}
+	}
+}
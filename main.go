@@ -5,6 +5,7 @@ import (
 	"math/rand"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,16 +23,42 @@ var (
 	///
 	Paused bool
 
+	/// Name of the platform profile selected with -profile.
+	///
+	Profile string
+
+	/// Quirks in effect for the currently loaded ROM.
+	///
+	ActiveQuirks chip8.Quirks
+
 	/// The CHIP-8 virtual machine.
 	///
 	VM *chip8.CHIP_8
 
+	/// Debugger attached to VM; breakpoints, watchpoints, and stepping.
+	///
+	Debug *chip8.Debugger
+
 	/// The SDL Window and Renderer.
 	///
 	Window *sdl.Window
 	Renderer *sdl.Renderer
+
+	/// Most recent quicksave, if any.
+	///
+	QuickSaveState []byte
+
+	/// Rolling 10-second rewind ring, one snapshot per video frame.
+	///
+	RewindBuffer [][]byte
+	RewindNext   int
+	RewindCount  int
 )
 
+/// Number of frames kept in RewindBuffer: 10 seconds at 60 Hz.
+///
+const RewindFrames = 10 * 60
+
 func init() {
 	runtime.LockOSThread()
 }
@@ -44,8 +71,17 @@ func main() {
 
 	// parse the command line
 	flag.BoolVar(&Break, "b", false, "Start ROM paused.")
+	flag.StringVar(&Profile, "profile", "xo-chip", "Platform profile: cosmac-vip, schip1.1, or xo-chip.")
 	flag.Parse()
 
+	// resolve the selected platform profile, falling back to XO-CHIP
+	if q, ok := chip8.Profile(Profile); ok {
+		ActiveQuirks = q
+	} else {
+		Logln("Unknown -profile:", Profile, "; defaulting to xo-chip")
+		ActiveQuirks = chip8.XOChip
+	}
+
 	// get the file name of the ROM to load
 	file := flag.Arg(0)
 
@@ -98,19 +134,96 @@ func main() {
 	for ProcessEvents() {
 		select {
 		case <-video.C:
+			if !Paused {
+				RewindPush()
+			}
+
 			Refresh()
 		case <-clock.C:
+			if !Paused && Debug.ShouldBreak(VM.PC) {
+				Paused = true
+
+				break
+			}
+
+			if !Paused {
+				Debug.RecordStep()
+			}
+
 			res := VM.Process(Paused)
 
-			switch res.(type) {
+			switch v := res.(type) {
 			case chip8.Breakpoint:
 				Log()
-				Log(res.Error())
+				Log(v.Error())
 
 				// break the emulation
 				Paused = true
+			case chip8.MemoryAccess:
+				if Debug.ShouldBreakOnAccess(v) {
+					Log()
+					Log("watchpoint hit at address", v.Address)
+
+					// break the emulation
+					Paused = true
+				}
 			}
+
+			if !Paused && Debug.ShouldBreakOnRegisters() {
+				Log()
+				Log("register watchpoint hit")
+
+				// break the emulation
+				Paused = true
+			}
+		}
+	}
+}
+
+/// ProcessEvents drains the SDL event queue for this frame and dispatches any
+/// hotkeys. It returns false once the user has asked to quit (closing the
+/// window), true otherwise.
+///
+func ProcessEvents() bool {
+	for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+		switch e := event.(type) {
+		case *sdl.QuitEvent:
+			return false
+		case *sdl.KeyboardEvent:
+			if e.Type == sdl.KEYDOWN && e.Repeat == 0 {
+				HandleKeyDown(e.Keysym.Sym)
+			}
+		}
+	}
+
+	return true
+}
+
+/// HandleKeyDown maps the debugger's hotkeys onto Debugger/Paused: F5 toggles
+/// pause, F6 single-steps, F7 steps over a CALL, F8 steps out of one, F9
+/// reverse-steps one instruction, F10 quicksaves, F11 quickloads, and F12
+/// rewinds one second.
+///
+func HandleKeyDown(key sdl.Keycode) {
+	switch key {
+	case sdl.K_F5:
+		Paused = !Paused
+	case sdl.K_F6:
+		Debug.StepInto()
+	case sdl.K_F7:
+		Debug.StepOver()
+	case sdl.K_F8:
+		Debug.StepOut()
+	case sdl.K_F9:
+		if err := Debug.ReverseStep(1); err != nil {
+			Log(err.Error())
 		}
+	case sdl.K_F10:
+		QuickSave()
+	case sdl.K_F11:
+		QuickLoad()
+	case sdl.K_F12:
+		Rewind(60)
 	}
 }
 
@@ -131,13 +244,19 @@ func LoadDialog() {
 func Load(file string) {
 	if file == "" {
 		Logln("Loading PONG... ")
-		VM, _ = chip8.LoadROM(chip8.Pong)
+		VM, _ = chip8.LoadROM(chip8.Pong, ActiveQuirks)
 	} else {
 		base := filepath.Base(file)
 
 		// show the action being taken
 		Logln("Loading", base)
 
+		// per-ROM quirks overrides live in a sidecar file next to the ROM
+		quirks, err := chip8.LoadQuirksSidecar(file, ActiveQuirks)
+		if err != nil {
+			Log(err.Error())
+		}
+
 		// is this a chip-8 assembly source file?
 		if strings.ToUpper(filepath.Ext(base)) == ".C8" {
 			asm, err := chip8.Assemble(file)
@@ -146,10 +265,179 @@ func Load(file string) {
 			}
 
 			// even on error, the assembly is valid
-			VM, _ = chip8.LoadAssembly(asm)
+			VM, _ = chip8.LoadAssembly(asm, quirks)
 		} else {
-			VM, _ = chip8.LoadFile(file)
+			VM, _ = chip8.LoadFile(file, quirks)
+		}
+	}
+
+	// (re)attach a fresh debugger for the newly loaded VM
+	Debug = chip8.NewDebugger(VM)
+
+	// reset quicksave and rewind state for the newly loaded VM
+	QuickSaveState = nil
+	RewindBuffer = make([][]byte, RewindFrames)
+	RewindNext = 0
+	RewindCount = 0
+}
+
+/// QuickSave captures the current machine state for a later QuickLoad.
+///
+func QuickSave() {
+	QuickSaveState = VM.Snapshot()
+
+	Log("Quicksaved")
+}
+
+/// QuickLoad restores the machine state captured by the last QuickSave.
+///
+func QuickLoad() {
+	if QuickSaveState == nil {
+		Log("No quicksave to load")
+
+		return
+	}
+
+	if err := VM.Restore(QuickSaveState); err != nil {
+		Log(err.Error())
+	}
+}
+
+/// RewindPush records the current machine state into the rolling rewind
+/// ring. Called once per video frame (60 Hz) so the ring covers roughly the
+/// last 10 seconds of play.
+///
+func RewindPush() {
+	RewindBuffer[RewindNext] = VM.Snapshot()
+	RewindNext = (RewindNext + 1) % len(RewindBuffer)
+
+	if RewindCount < len(RewindBuffer) {
+		RewindCount++
+	}
+}
+
+/// Rewind scrubs the emulator back n frames through the rewind ring.
+///
+func Rewind(n int) {
+	if n <= 0 || n > RewindCount {
+		Log("Nothing left to rewind")
+
+		return
+	}
+
+	i := (RewindNext - n + len(RewindBuffer)) % len(RewindBuffer)
+
+	if err := VM.Restore(RewindBuffer[i]); err != nil {
+		Log(err.Error())
+
+		return
+	}
+
+	RewindCount -= n
+	RewindNext = i
+}
+
+/// DebugCommand parses and runs a line of text typed into the debug pane's
+/// command prompt: "b #200" (breakpoint), "b #200 V0 == 1" (conditional),
+/// "w #300 16 rw" (watchpoint), "wr V0 #1" (register watchpoint),
+/// "step"/"over"/"out", "rback N" (reverse), "save"/"load" (quicksave), or
+/// "rewind N" (scrub back N video frames).
+///
+func DebugCommand(line string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "b", "break":
+		if len(fields) < 2 {
+			Log("usage: b <address> [condition]")
+
+			return
+		}
+
+		addr, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "#"), 16, 32)
+		if err != nil {
+			Log(err.Error())
+
+			return
 		}
+
+		Debug.AddBreakpoint(uint(addr), strings.Join(fields[2:], " "))
+	case "w", "watch":
+		if len(fields) < 4 {
+			Log("usage: w <address> <length> <r|w|rw>")
+
+			return
+		}
+
+		addr, err := strconv.ParseUint(strings.TrimPrefix(fields[1], "#"), 16, 32)
+		if err != nil {
+			Log(err.Error())
+
+			return
+		}
+
+		length, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			Log(err.Error())
+
+			return
+		}
+
+		mode := strings.ToLower(fields[3])
+
+		Debug.AddWatchpoint(uint(addr), uint(length), strings.Contains(mode, "r"), strings.Contains(mode, "w"))
+	case "wr", "rwatch":
+		if len(fields) < 3 {
+			Log("usage: wr <register> <value>")
+
+			return
+		}
+
+		value, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "#"), 16, 16)
+		if err != nil {
+			Log(err.Error())
+
+			return
+		}
+
+		Debug.AddRegisterWatch(fields[1], byte(value))
+	case "step", "s":
+		Debug.StepInto()
+	case "over", "o":
+		Debug.StepOver()
+	case "out", "u":
+		Debug.StepOut()
+	case "rback", "r":
+		n := 1
+
+		if len(fields) > 1 {
+			if v, err := strconv.Atoi(fields[1]); err == nil {
+				n = v
+			}
+		}
+
+		if err := Debug.ReverseStep(n); err != nil {
+			Log(err.Error())
+		}
+	case "save":
+		QuickSave()
+	case "load":
+		QuickLoad()
+	case "rewind":
+		n := 60
+
+		if len(fields) > 1 {
+			if v, err := strconv.Atoi(fields[1]); err == nil {
+				n = v
+			}
+		}
+
+		Rewind(n)
+	default:
+		Log("unknown debug command:", fields[0])
 	}
 }
 